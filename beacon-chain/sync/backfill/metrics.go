@@ -0,0 +1,15 @@
+package backfill
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	backfillStartGapSlot = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "backfill_start_gap_slot",
+			Help: "Slot at the beginning of the range that still needs to be backfilled.",
+		},
+	)
+)
@@ -2,6 +2,7 @@ package backfill
 
 import (
 	"context"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/prysmaticlabs/prysm/v4/beacon-chain/db"
@@ -23,51 +24,152 @@ func NewStatus(store BackfillDB) *Status {
 // end of the missing block range via the Advance() method, to check whether a Slot is missing from the database
 // via the SlotCovered() method, and to see the current StartGap() and EndGap().
 type Status struct {
-	start       primitives.Slot
-	end         primitives.Slot
-	store       BackfillDB
-	genesisSync bool
+	lock             sync.RWMutex
+	start            primitives.Slot
+	end              primitives.Slot
+	root             [32]byte
+	originRoot       [32]byte
+	originParentRoot [32]byte
+	store            BackfillDB
+	genesisSync      bool
 }
 
 // SlotCovered uses StartGap() and EndGap() to determine if the given slot is covered by the current chain history.
 // If the slot is <= StartGap(), or >= EndGap(), the result is true.
 // If the slot is between StartGap() and EndGap(), the result is false.
 func (s *Status) SlotCovered(sl primitives.Slot) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 	// short circuit if the node was synced from genesis
 	if s.genesisSync {
 		return true
 	}
-	if s.StartGap() < sl && sl < s.EndGap() {
+	if s.start < sl && sl < s.end {
 		return false
 	}
 	return true
 }
 
+// RangeCovered is the range equivalent of SlotCovered. It returns true only if every slot from lo to hi (inclusive)
+// is covered by the current chain history, ie the range does not overlap the gap between StartGap() and EndGap().
+// An inverted range, where lo > hi, is never covered.
+func (s *Status) RangeCovered(lo, hi primitives.Slot) bool {
+	if lo > hi {
+		return false
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.genesisSync {
+		return true
+	}
+	if hi <= s.start || lo >= s.end {
+		return true
+	}
+	return s.gapEmpty()
+}
+
+// gapEmpty is true once the backfill position is directly below the origin, leaving no slots in between to backfill.
+// Callers must hold the lock.
+func (s *Status) gapEmpty() bool {
+	return s.start+1 >= s.end
+}
+
 // StartGap returns the slot at the beginning of the range that needs to be backfilled.
 func (s *Status) StartGap() primitives.Slot {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 	return s.start
 }
 
 // EndGap returns the slot at the end of the range that needs to be backfilled.
 func (s *Status) EndGap() primitives.Slot {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 	return s.end
 }
 
+// Progress returns the fraction of the history between genesis and the origin checkpoint that has been backfilled,
+// as a value between 0 and 1. Before Reload has found an origin checkpoint the result is 0, and a node synced from
+// genesis is always reported as complete.
+func (s *Status) Progress() float64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.genesisSync {
+		return 1
+	}
+	if s.end == 0 {
+		return 0
+	}
+	// the gap holds end-1 slots, so this reaches 1 when start is directly below end. gapEmpty also keeps the
+	// result from exceeding 1 once start reaches the origin, and avoids dividing by zero when end is 1.
+	if s.gapEmpty() {
+		return 1
+	}
+	return float64(s.start) / float64(s.end-1)
+}
+
+// RemainingSlots returns the number of slots between StartGap() and EndGap() that have not been backfilled yet.
+// The result is 0 once backfill is complete, or if the node was synced from genesis.
+func (s *Status) RemainingSlots() primitives.Slot {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.genesisSync || s.gapEmpty() {
+		return 0
+	}
+	return s.end - s.start - 1
+}
+
 var ErrAdvancePastOrigin = errors.New("cannot advance backfill Status beyond the origin checkpoint slot")
+var ErrAdvanceBackwards = errors.New("cannot move backfill Status below its current position")
+var ErrOriginRootMismatch = errors.New("backfill reached the origin checkpoint slot with a block root that does not match the origin")
+var ErrOriginParentMismatch = errors.New("backfill does not connect to the parent of the origin checkpoint block")
 
 // Advance advances the backfill position to the given slot & root.
 // It updates the backfill block root entry in the database,
 // and also updates the Status value's copy of the backfill position slot.
+// The position only moves forward; a slot below StartGap() is rejected with ErrAdvanceBackwards.
+// The backfilled history must connect to the origin checkpoint block through its parent root, so advancing to the slot
+// directly below the origin requires the root of the origin block's parent. Backfill can also be finished by advancing
+// to EndGap() with the origin block root, which is how callers complete it when the slots directly below the origin
+// were skipped; this requires the current backfill position to already be the origin block's parent.
+// ErrOriginParentMismatch or ErrOriginRootMismatch is returned if the history does not connect to the origin.
+// Once backfill has reached the origin, advancing to EndGap() with the origin block root again is a no-op.
 func (s *Status) Advance(ctx context.Context, upTo primitives.Slot, root [32]byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	if upTo > s.end {
 		return errors.Wrapf(ErrAdvancePastOrigin, "advance slot=%d, origin slot=%d", upTo, s.end)
 	}
+	if upTo < s.start {
+		return errors.Wrapf(ErrAdvanceBackwards, "advance slot=%d, backfill slot=%d", upTo, s.start)
+	}
+	if upTo == s.end && s.start == s.end && root == s.originRoot {
+		return nil
+	}
+	if upTo+1 == s.end && root != s.originParentRoot {
+		return errors.Wrapf(ErrOriginParentMismatch, "advance root=%#x, origin parent root=%#x", root, s.originParentRoot)
+	}
+	if upTo == s.end {
+		if root != s.originRoot {
+			return errors.Wrapf(ErrOriginRootMismatch, "advance root=%#x, origin root=%#x", root, s.originRoot)
+		}
+		if s.root != s.originParentRoot {
+			return errors.Wrapf(ErrOriginParentMismatch, "backfill root=%#x, origin parent root=%#x", s.root, s.originParentRoot)
+		}
+	}
+	if err := s.store.SaveBackfillBlockRoot(ctx, root); err != nil {
+		return err
+	}
 	s.start = upTo
-	return s.store.SaveBackfillBlockRoot(ctx, root)
+	s.root = root
+	backfillStartGapSlot.Set(float64(upTo))
+	return nil
 }
 
 // Reload queries the database for backfill status, initializing the internal data and validating the database state.
 func (s *Status) Reload(ctx context.Context) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	cpRoot, err := s.store.OriginCheckpointBlockRoot(ctx)
 	if err != nil {
 		// mark genesis sync and short circuit further lookups
@@ -85,6 +187,8 @@ func (s *Status) Reload(ctx context.Context) error {
 		return err
 	}
 	s.end = cpBlock.Block().Slot()
+	s.originRoot = cpRoot
+	s.originParentRoot = cpBlock.Block().ParentRoot()
 
 	_, err = s.store.GenesisBlockRoot(ctx)
 	if err != nil {
@@ -109,6 +213,8 @@ func (s *Status) Reload(ctx context.Context) error {
 		return err
 	}
 	s.start = bfBlock.Block().Slot()
+	s.root = bfRoot
+	backfillStartGapSlot.Set(float64(s.start))
 	return nil
 }
 
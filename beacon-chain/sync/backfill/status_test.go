@@ -2,6 +2,7 @@ package backfill
 
 import (
 	"context"
+	"runtime"
 	"testing"
 
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/blocks"
@@ -9,6 +10,7 @@ import (
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/interfaces"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prysmaticlabs/prysm/v4/config/params"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
 	"github.com/prysmaticlabs/prysm/v4/testing/require"
@@ -112,6 +114,92 @@ func TestSlotCovered(t *testing.T) {
 	}
 }
 
+func TestRangeCovered(t *testing.T) {
+	cases := []struct {
+		name   string
+		lo     primitives.Slot
+		hi     primitives.Slot
+		status *Status
+		result bool
+	}{
+		{
+			name:   "fully below start true",
+			status: &Status{start: 10, end: 20},
+			lo:     0,
+			hi:     10,
+			result: true,
+		},
+		{
+			name:   "fully above end true",
+			status: &Status{start: 10, end: 20},
+			lo:     20,
+			hi:     30,
+			result: true,
+		},
+		{
+			name:   "straddling start false",
+			status: &Status{start: 10, end: 20},
+			lo:     5,
+			hi:     11,
+			result: false,
+		},
+		{
+			name:   "straddling end false",
+			status: &Status{start: 10, end: 20},
+			lo:     19,
+			hi:     25,
+			result: false,
+		},
+		{
+			name:   "spanning whole gap false",
+			status: &Status{start: 10, end: 20},
+			lo:     0,
+			hi:     30,
+			result: false,
+		},
+		{
+			name:   "within gap false",
+			status: &Status{start: 10, end: 20},
+			lo:     12,
+			hi:     15,
+			result: false,
+		},
+		{
+			name:   "single slot in gap false",
+			status: &Status{start: 10, end: 20},
+			lo:     15,
+			hi:     15,
+			result: false,
+		},
+		{
+			name:   "empty gap true",
+			status: &Status{start: 19, end: 20},
+			lo:     0,
+			hi:     30,
+			result: true,
+		},
+		{
+			name:   "inverted range false",
+			status: &Status{start: 10, end: 20},
+			lo:     5,
+			hi:     4,
+			result: false,
+		},
+		{
+			name:   "genesisSync always true",
+			status: &Status{genesisSync: true},
+			lo:     0,
+			hi:     100,
+			result: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.result, c.status.RangeCovered(c.lo, c.hi))
+		})
+	}
+}
+
 func TestAdvance(t *testing.T) {
 	ctx := context.Background()
 	saveBackfillBuf := make([][32]byte, 0)
@@ -136,12 +224,244 @@ func TestAdvance(t *testing.T) {
 	require.Equal(t, 1, len(saveBackfillBuf))
 }
 
+func TestProgress(t *testing.T) {
+	cases := []struct {
+		name     string
+		status   *Status
+		progress float64
+	}{
+		{
+			name:     "not reloaded",
+			status:   &Status{},
+			progress: 0,
+		},
+		{
+			name:     "genesisSync complete",
+			status:   &Status{genesisSync: true},
+			progress: 1,
+		},
+		{
+			name:     "at genesis",
+			status:   &Status{start: 0, end: 100},
+			progress: 0,
+		},
+		{
+			name:     "halfway",
+			status:   &Status{start: 50, end: 101},
+			progress: 0.5,
+		},
+		{
+			name:     "origin one slot after genesis",
+			status:   &Status{start: 0, end: 1},
+			progress: 1,
+		},
+		{
+			name:     "no slots left in gap",
+			status:   &Status{start: 99, end: 100},
+			progress: 1,
+		},
+		{
+			name:     "at origin",
+			status:   &Status{start: 100, end: 100},
+			progress: 1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.progress, c.status.Progress())
+		})
+	}
+}
+
+func TestProgressAdvance(t *testing.T) {
+	ctx := context.Background()
+	s, _ := setupAdvanceStatus(0, 100, [32]byte{0x01}, [32]byte{0x02})
+	prev := s.Progress()
+	require.Equal(t, float64(0), prev)
+	for _, sl := range []primitives.Slot{10, 20, 30, 40, 50, 60, 70, 80, 90, s.end - 1} {
+		root := [32]byte{byte(sl)}
+		if sl == s.end-1 {
+			root = s.originParentRoot
+		}
+		require.NoError(t, s.Advance(ctx, sl, root))
+		p := s.Progress()
+		require.Equal(t, true, p > prev)
+		prev = p
+
+		// a lower slot is rejected, so progress never drops
+		require.ErrorIs(t, s.Advance(ctx, sl-5, [32]byte{byte(sl - 5)}), ErrAdvanceBackwards)
+		require.Equal(t, prev, s.Progress())
+	}
+	require.Equal(t, float64(1), prev)
+}
+
+func TestConcurrentAdvanceAndRead(t *testing.T) {
+	ctx := context.Background()
+	s, _ := setupAdvanceStatus(0, 200, [32]byte{0x01}, [32]byte{0x02})
+	started := make(chan struct{})
+	stop := make(chan struct{})
+	reads := make(chan int)
+	go func() {
+		n := 0
+		prev := float64(0)
+		close(started)
+		for {
+			select {
+			case <-stop:
+				reads <- n
+				return
+			default:
+				p := s.Progress()
+				if p < prev {
+					t.Errorf("progress went backwards from %f to %f", prev, p)
+				}
+				prev = p
+				s.SlotCovered(100)
+				n++
+				runtime.Gosched()
+			}
+		}
+	}()
+	<-started
+	for sl := primitives.Slot(1); sl < s.end-1; sl++ {
+		require.NoError(t, s.Advance(ctx, sl, [32]byte{byte(sl)}))
+		// yield so that reads and writes interleave even with a single CPU
+		runtime.Gosched()
+	}
+	close(stop)
+	require.Equal(t, true, <-reads > 0)
+	require.Equal(t, s.end-2, s.StartGap())
+}
+
+func TestAdvanceStartGapSlotMetric(t *testing.T) {
+	ctx := context.Background()
+	s, saved := setupAdvanceStatus(0, 100, [32]byte{0x01}, [32]byte{0x02})
+	requireAgree := func(slot primitives.Slot, root [32]byte) {
+		require.Equal(t, slot, s.StartGap())
+		require.Equal(t, float64(slot), testutil.ToFloat64(backfillStartGapSlot))
+		require.Equal(t, root, (*saved)[len(*saved)-1])
+		require.Equal(t, root, s.root)
+	}
+	require.NoError(t, s.Advance(ctx, 40, [32]byte{0x40}))
+	requireAgree(40, [32]byte{0x40})
+
+	// moving backwards is rejected before anything is saved
+	require.ErrorIs(t, s.Advance(ctx, 30, [32]byte{0x30}), ErrAdvanceBackwards)
+	require.Equal(t, 1, len(*saved))
+	requireAgree(40, [32]byte{0x40})
+
+	// a failed save leaves the position, the saved root and the metric untouched
+	derp := errors.New("derp")
+	mdb := s.store
+	s.store = &mockBackfillDB{
+		saveBackfillBlockRoot: func(ctx context.Context, root [32]byte) error {
+			return derp
+		},
+	}
+	require.ErrorIs(t, s.Advance(ctx, 50, [32]byte{0x50}), derp)
+	requireAgree(40, [32]byte{0x40})
+
+	s.store = mdb
+	require.NoError(t, s.Advance(ctx, 50, [32]byte{0x50}))
+	requireAgree(50, [32]byte{0x50})
+}
+
+func TestAdvanceToOrigin(t *testing.T) {
+	ctx := context.Background()
+	originRoot, originParentRoot, badRoot := [32]byte{0x01}, [32]byte{0x02}, [32]byte{0x03}
+
+	t.Run("through origin parent", func(t *testing.T) {
+		s, saved := setupAdvanceStatus(90, 100, originRoot, originParentRoot)
+		// a corrupted final parent root must not be recorded as the backfill position
+		require.ErrorIs(t, s.Advance(ctx, s.end-1, badRoot), ErrOriginParentMismatch)
+		require.Equal(t, 0, len(*saved))
+		require.Equal(t, primitives.Slot(90), s.StartGap())
+		require.Equal(t, float64(90)/99, s.Progress())
+
+		require.NoError(t, s.Advance(ctx, s.end-1, originParentRoot))
+		require.NoError(t, s.Advance(ctx, s.end, originRoot))
+		require.DeepEqual(t, [][32]byte{originParentRoot, originRoot}, *saved)
+		require.Equal(t, float64(1), s.Progress())
+
+		// completing again is a no-op rather than a parent mismatch, and isn't saved twice
+		require.NoError(t, s.Advance(ctx, s.end, originRoot))
+		require.DeepEqual(t, [][32]byte{originParentRoot, originRoot}, *saved)
+		// but a different root at the origin is still rejected
+		require.ErrorIs(t, s.Advance(ctx, s.end, badRoot), ErrOriginRootMismatch)
+	})
+	t.Run("wrong origin root", func(t *testing.T) {
+		s, saved := setupAdvanceStatus(90, 100, originRoot, originParentRoot)
+		s.root = originParentRoot
+		require.ErrorIs(t, s.Advance(ctx, s.end, badRoot), ErrOriginRootMismatch)
+		require.Equal(t, 0, len(*saved))
+		require.Equal(t, primitives.Slot(90), s.StartGap())
+	})
+	t.Run("skipped slots below origin", func(t *testing.T) {
+		// the origin's parent is at slot 90, and slots 91-99 are empty
+		s, saved := setupAdvanceStatus(90, 100, originRoot, originParentRoot)
+		s.root = originParentRoot
+		require.NoError(t, s.Advance(ctx, s.end, originRoot))
+		require.DeepEqual(t, [][32]byte{originRoot}, *saved)
+		require.Equal(t, float64(1), s.Progress())
+	})
+	t.Run("skipped slots below origin, corrupted parent root", func(t *testing.T) {
+		s, saved := setupAdvanceStatus(90, 100, originRoot, originParentRoot)
+		s.root = badRoot
+		require.ErrorIs(t, s.Advance(ctx, s.end, originRoot), ErrOriginParentMismatch)
+		require.Equal(t, 0, len(*saved))
+		require.Equal(t, primitives.Slot(90), s.StartGap())
+	})
+}
+
+func TestRemainingSlots(t *testing.T) {
+	ctx := context.Background()
+	originRoot, originParentRoot := [32]byte{0x01}, [32]byte{0x02}
+	s, _ := setupAdvanceStatus(0, 64, originRoot, originParentRoot)
+	uncovered := func() primitives.Slot {
+		var n primitives.Slot
+		for sl := primitives.Slot(0); sl <= s.EndGap(); sl++ {
+			if !s.SlotCovered(sl) {
+				n++
+			}
+		}
+		return n
+	}
+	require.Equal(t, primitives.Slot(63), s.RemainingSlots())
+	for _, sl := range []primitives.Slot{1, 17, 32, 62, 63} {
+		root := [32]byte{byte(sl)}
+		if sl == s.end-1 {
+			root = originParentRoot
+		}
+		require.NoError(t, s.Advance(ctx, sl, root))
+		require.Equal(t, uncovered(), s.RemainingSlots())
+	}
+	require.Equal(t, primitives.Slot(0), s.RemainingSlots())
+	require.NoError(t, s.Advance(ctx, s.end, originRoot))
+	require.Equal(t, primitives.Slot(0), s.RemainingSlots())
+
+	gs := &Status{genesisSync: true}
+	require.Equal(t, primitives.Slot(0), gs.RemainingSlots())
+}
+
 func goodBlockRoot(root [32]byte) func(ctx context.Context) ([32]byte, error) {
 	return func(ctx context.Context) ([32]byte, error) {
 		return root, nil
 	}
 }
 
+// setupAdvanceStatus returns a Status with a gap from start to end, ready to be moved with Advance. The mock db
+// accepts every backfill root save and records the roots in the returned slice.
+func setupAdvanceStatus(start, end primitives.Slot, originRoot, originParentRoot [32]byte) (*Status, *[][32]byte) {
+	saved := make([][32]byte, 0)
+	mdb := &mockBackfillDB{
+		saveBackfillBlockRoot: func(ctx context.Context, root [32]byte) error {
+			saved = append(saved, root)
+			return nil
+		},
+	}
+	return &Status{start: start, end: end, originRoot: originRoot, originParentRoot: originParentRoot, store: mdb}, &saved
+}
+
 func setupTestBlock(slot primitives.Slot) (interfaces.ReadOnlySignedBeaconBlock, error) {
 	bRaw := util.NewBeaconBlock()
 	b, err := blocks.NewSignedBeaconBlock(bRaw)
@@ -160,6 +480,10 @@ func TestReload(t *testing.T) {
 	copy(originRoot[:], []byte{0x01})
 	originBlock, err := setupTestBlock(originSlot)
 	require.NoError(t, err)
+	var originParentRoot [32]byte
+	copy(originParentRoot[:], []byte{0x03})
+	originBlock, err = blocktest.SetBlockParentRoot(originBlock.(interfaces.SignedBeaconBlock), originParentRoot)
+	require.NoError(t, err)
 
 	backfillSlot := primitives.Slot(50)
 	var backfillRoot [32]byte
@@ -334,7 +658,7 @@ func TestReload(t *testing.T) {
 				backfillBlockRoot: goodBlockRoot(backfillRoot),
 			},
 			err:      derp,
-			expected: &Status{genesisSync: false, start: backfillSlot, end: originSlot},
+			expected: &Status{genesisSync: false, start: backfillSlot, end: originSlot, root: backfillRoot, originRoot: originRoot, originParentRoot: originParentRoot},
 		},
 	}
 
@@ -354,5 +678,9 @@ func TestReload(t *testing.T) {
 		require.Equal(t, c.expected.genesisSync, s.genesisSync)
 		require.Equal(t, c.expected.start, s.start)
 		require.Equal(t, c.expected.end, s.end)
+		require.Equal(t, c.expected.originRoot, s.originRoot)
+		require.Equal(t, c.expected.originParentRoot, s.originParentRoot)
+		require.Equal(t, c.expected.root, s.root)
+		require.Equal(t, float64(c.expected.start), testutil.ToFloat64(backfillStartGapSlot))
 	}
 }